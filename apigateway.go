@@ -0,0 +1,258 @@
+package awslambda
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// Supported values for Config.PayloadFormat.
+const (
+	PayloadFormatNative       = "native"
+	PayloadFormatAPIGateway   = "apigateway"
+	PayloadFormatAPIGatewayV2 = "apigatewayv2"
+)
+
+// APIGatewayRequest mirrors the event shape API Gateway sends to a Lambda
+// function behind a REST API proxy integration.
+type APIGatewayRequest struct {
+	HTTPMethod                      string                   `json:"httpMethod"`
+	Path                            string                   `json:"path"`
+	Resource                        string                   `json:"resource"`
+	Headers                         map[string]string        `json:"headers"`
+	MultiValueHeaders               map[string][]string      `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string        `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string      `json:"multiValueQueryStringParameters"`
+	PathParameters                  map[string]string        `json:"pathParameters"`
+	RequestContext                  APIGatewayRequestContext `json:"requestContext"`
+	Body                            string                   `json:"body"`
+	IsBase64Encoded                 bool                     `json:"isBase64Encoded"`
+}
+
+// APIGatewayRequestContext is the (trimmed) requestContext object included
+// with an APIGatewayRequest.
+type APIGatewayRequestContext struct {
+	Path       string `json:"path"`
+	HTTPMethod string `json:"httpMethod"`
+}
+
+// APIGatewayReply mirrors the response shape API Gateway expects back from a
+// REST API proxy integration Lambda function.
+type APIGatewayReply struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// NewAPIGatewayRequest builds the API Gateway REST proxy event payload for r.
+// If r's Content-Type matches one of binaryMediaTypes, the body is
+// base64-encoded and IsBase64Encoded is set.
+func NewAPIGatewayRequest(r *http.Request, binaryMediaTypes []string) (*APIGatewayRequest, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	multiValueHeaders := make(map[string][]string, len(r.Header))
+	for k, vals := range r.Header {
+		headers[k] = vals[len(vals)-1]
+		multiValueHeaders[k] = vals
+	}
+
+	query := r.URL.Query()
+	queryStringParameters := make(map[string]string, len(query))
+	multiValueQueryStringParameters := make(map[string][]string, len(query))
+	for k, vals := range query {
+		queryStringParameters[k] = vals[len(vals)-1]
+		multiValueQueryStringParameters[k] = vals
+	}
+
+	req := &APIGatewayRequest{
+		HTTPMethod:                      r.Method,
+		Path:                            r.URL.Path,
+		Resource:                        r.URL.Path,
+		Headers:                         headers,
+		MultiValueHeaders:               multiValueHeaders,
+		QueryStringParameters:           queryStringParameters,
+		MultiValueQueryStringParameters: multiValueQueryStringParameters,
+		RequestContext: APIGatewayRequestContext{
+			Path:       r.URL.Path,
+			HTTPMethod: r.Method,
+		},
+	}
+
+	if matchesBinaryType(r.Header.Get("Content-Type"), binaryMediaTypes) {
+		req.Body = base64.StdEncoding.EncodeToString(body)
+		req.IsBase64Encoded = true
+	} else {
+		req.Body = string(body)
+	}
+
+	return req, nil
+}
+
+func parseAPIGatewayReply(payload []byte, binaryMediaTypes []string) (*Reply, error) {
+	if len(payload) == 0 {
+		return new(Reply), nil
+	}
+
+	var raw APIGatewayReply
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+
+	// API Gateway populates both Headers and MultiValueHeaders with the same
+	// data when a Lambda author sets one; MultiValueHeaders is simply the
+	// superset, so consulting it alone (falling back to Headers for a key it
+	// doesn't have) avoids emitting duplicated values.
+	headers := make(http.Header)
+	for k, v := range raw.Headers {
+		headers.Set(k, v)
+	}
+	for k, vals := range raw.MultiValueHeaders {
+		headers.Del(k)
+		for _, v := range vals {
+			headers.Add(k, v)
+		}
+	}
+
+	encoded := raw.IsBase64Encoded || matchesBinaryType(headers.Get("Content-Type"), binaryMediaTypes)
+	body, err := decodeBody(raw.Body, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reply{
+		Meta: ReplyMeta{
+			Status:  raw.StatusCode,
+			Headers: headers,
+		},
+		Body: body,
+	}, nil
+}
+
+// APIGatewayV2Request mirrors the event shape API Gateway sends to a Lambda
+// function behind an HTTP API (v2) integration.
+type APIGatewayV2Request struct {
+	Version               string                     `json:"version"`
+	RouteKey              string                     `json:"routeKey"`
+	RawPath               string                     `json:"rawPath"`
+	RawQueryString        string                     `json:"rawQueryString"`
+	Headers               map[string]string          `json:"headers"`
+	QueryStringParameters map[string]string          `json:"queryStringParameters"`
+	RequestContext        APIGatewayV2RequestContext `json:"requestContext"`
+	Body                  string                     `json:"body"`
+	IsBase64Encoded       bool                       `json:"isBase64Encoded"`
+}
+
+// APIGatewayV2RequestContext is the (trimmed) requestContext object included
+// with an APIGatewayV2Request.
+type APIGatewayV2RequestContext struct {
+	HTTP APIGatewayV2HTTPContext `json:"http"`
+}
+
+// APIGatewayV2HTTPContext carries the method and path for a v2 request.
+type APIGatewayV2HTTPContext struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// APIGatewayV2Reply mirrors the response shape API Gateway expects back from
+// an HTTP API (v2) integration Lambda function.
+type APIGatewayV2Reply struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// NewAPIGatewayV2Request builds the API Gateway HTTP API (v2) event payload
+// for r. If r's Content-Type matches one of binaryMediaTypes, the body is
+// base64-encoded and IsBase64Encoded is set.
+func NewAPIGatewayV2Request(r *http.Request, binaryMediaTypes []string) (*APIGatewayV2Request, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for k, vals := range r.Header {
+		headers[k] = vals[len(vals)-1]
+	}
+
+	query := r.URL.Query()
+	queryStringParameters := make(map[string]string, len(query))
+	for k, vals := range query {
+		queryStringParameters[k] = vals[len(vals)-1]
+	}
+
+	req := &APIGatewayV2Request{
+		Version:               "2.0",
+		RouteKey:              r.Method + " " + r.URL.Path,
+		RawPath:               r.URL.Path,
+		RawQueryString:        r.URL.RawQuery,
+		Headers:               headers,
+		QueryStringParameters: queryStringParameters,
+		RequestContext: APIGatewayV2RequestContext{
+			HTTP: APIGatewayV2HTTPContext{
+				Method: r.Method,
+				Path:   r.URL.Path,
+			},
+		},
+	}
+
+	if matchesBinaryType(r.Header.Get("Content-Type"), binaryMediaTypes) {
+		req.Body = base64.StdEncoding.EncodeToString(body)
+		req.IsBase64Encoded = true
+	} else {
+		req.Body = string(body)
+	}
+
+	return req, nil
+}
+
+func parseAPIGatewayV2Reply(payload []byte, binaryMediaTypes []string) (*Reply, error) {
+	if len(payload) == 0 {
+		return new(Reply), nil
+	}
+
+	var raw APIGatewayV2Reply
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+
+	headers := make(http.Header)
+	for k, v := range raw.Headers {
+		headers.Set(k, v)
+	}
+
+	encoded := raw.IsBase64Encoded || matchesBinaryType(headers.Get("Content-Type"), binaryMediaTypes)
+	body, err := decodeBody(raw.Body, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reply{
+		Meta: ReplyMeta{
+			Status:  raw.StatusCode,
+			Headers: headers,
+		},
+		Body: body,
+	}, nil
+}
+
+// decodeBody returns body as-is, or base64-decoded if encoded is true.
+func decodeBody(body string, encoded bool) (string, error) {
+	if !encoded {
+		return body, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
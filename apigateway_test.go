@@ -0,0 +1,127 @@
+package awslambda
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNewAPIGatewayRequest(t *testing.T) {
+	r := mustNewRequest("GET", "/api/user?name=joe&name=jane", bytes.NewBufferString("hello world"))
+	r.Header.Set("X-Test", "one")
+
+	req, err := NewAPIGatewayRequest(r, nil)
+	if err != nil {
+		t.Fatalf("NewAPIGatewayRequest returned err: %v", err)
+	}
+
+	if req.HTTPMethod != "GET" {
+		t.Errorf("Expected HTTPMethod GET, got %s", req.HTTPMethod)
+	}
+	if req.Path != "/api/user" {
+		t.Errorf("Expected Path /api/user, got %s", req.Path)
+	}
+	if req.Headers["X-Test"] != "one" {
+		t.Errorf("Expected Headers[X-Test] = one, got %s", req.Headers["X-Test"])
+	}
+	if req.QueryStringParameters["name"] != "jane" {
+		t.Errorf("Expected last query value jane, got %s", req.QueryStringParameters["name"])
+	}
+	if !reflect.DeepEqual(req.MultiValueQueryStringParameters["name"], []string{"joe", "jane"}) {
+		t.Errorf("Expected multi-value query [joe jane], got %v", req.MultiValueQueryStringParameters["name"])
+	}
+	if req.Body != "hello world" {
+		t.Errorf("Expected Body hello world, got %s", req.Body)
+	}
+}
+
+func TestNewAPIGatewayRequestBinaryEncoding(t *testing.T) {
+	r := mustNewRequest("POST", "/upload", bytes.NewBufferString("\x89PNG"))
+	r.Header.Set("Content-Type", "image/png")
+
+	req, err := NewAPIGatewayRequest(r, []string{"image/*"})
+	if err != nil {
+		t.Fatalf("NewAPIGatewayRequest returned err: %v", err)
+	}
+	if !req.IsBase64Encoded {
+		t.Fatalf("Expected IsBase64Encoded to be true")
+	}
+	if req.Body != "iVBORw==" {
+		t.Errorf("Expected base64 body iVBORw==, got %s", req.Body)
+	}
+}
+
+func TestNewAPIGatewayV2RequestBinaryEncoding(t *testing.T) {
+	r := mustNewRequest("POST", "/upload", bytes.NewBufferString("\x89PNG"))
+	r.Header.Set("Content-Type", "image/png")
+
+	req, err := NewAPIGatewayV2Request(r, []string{"image/*"})
+	if err != nil {
+		t.Fatalf("NewAPIGatewayV2Request returned err: %v", err)
+	}
+	if !req.IsBase64Encoded {
+		t.Fatalf("Expected IsBase64Encoded to be true")
+	}
+	if req.Body != "iVBORw==" {
+		t.Errorf("Expected base64 body iVBORw==, got %s", req.Body)
+	}
+}
+
+func TestParseAPIGatewayReply(t *testing.T) {
+	payload := []byte(`{"statusCode":201,"headers":{"Content-Type":"text/plain"},"body":"created"}`)
+	reply, err := parseAPIGatewayReply(payload, nil)
+	if err != nil {
+		t.Fatalf("parseAPIGatewayReply returned err: %v", err)
+	}
+	if reply.Meta.Status != 201 {
+		t.Errorf("Expected status 201, got %d", reply.Meta.Status)
+	}
+	if reply.Meta.Headers.Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected Content-Type text/plain, got %s", reply.Meta.Headers.Get("Content-Type"))
+	}
+	if reply.Body != "created" {
+		t.Errorf("Expected body created, got %s", reply.Body)
+	}
+}
+
+func TestParseAPIGatewayReplyBase64(t *testing.T) {
+	payload := []byte(`{"statusCode":200,"body":"aGVsbG8=","isBase64Encoded":true}`)
+	reply, err := parseAPIGatewayReply(payload, nil)
+	if err != nil {
+		t.Fatalf("parseAPIGatewayReply returned err: %v", err)
+	}
+	if reply.Body != "hello" {
+		t.Errorf("Expected decoded body hello, got %s", reply.Body)
+	}
+}
+
+func TestParseAPIGatewayReplyMultiValueHeadersNoDuplicate(t *testing.T) {
+	payload := []byte(`{"statusCode":200,"headers":{"Content-Type":"text/plain"},"multiValueHeaders":{"Content-Type":["text/plain"],"Set-Cookie":["a=1","b=2"]},"body":"ok"}`)
+	reply, err := parseAPIGatewayReply(payload, nil)
+	if err != nil {
+		t.Fatalf("parseAPIGatewayReply returned err: %v", err)
+	}
+	if got := reply.Meta.Headers["Content-Type"]; !reflect.DeepEqual(got, []string{"text/plain"}) {
+		t.Errorf("Expected Content-Type set once, got %v", got)
+	}
+	if got := reply.Meta.Headers["Set-Cookie"]; !reflect.DeepEqual(got, []string{"a=1", "b=2"}) {
+		t.Errorf("Expected Set-Cookie a=1, b=2, got %v", got)
+	}
+}
+
+func TestParseAPIGatewayV2Reply(t *testing.T) {
+	payload := []byte(`{"statusCode":404,"headers":{"X-Test":"v2"},"body":"missing"}`)
+	reply, err := parseAPIGatewayV2Reply(payload, nil)
+	if err != nil {
+		t.Fatalf("parseAPIGatewayV2Reply returned err: %v", err)
+	}
+	if reply.Meta.Status != 404 {
+		t.Errorf("Expected status 404, got %d", reply.Meta.Status)
+	}
+	if reply.Meta.Headers.Get("X-Test") != "v2" {
+		t.Errorf("Expected X-Test v2, got %s", reply.Meta.Headers.Get("X-Test"))
+	}
+	if reply.Body != "missing" {
+		t.Errorf("Expected body missing, got %s", reply.Body)
+	}
+}
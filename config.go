@@ -0,0 +1,584 @@
+package awslambda
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mholt/caddy"
+)
+
+// Supported values for Config.InvocationType.
+const (
+	InvocationTypeRequestResponse = "RequestResponse"
+	InvocationTypeEvent           = "Event"
+	InvocationTypeDryRun          = "DryRun"
+)
+
+// LogTypeTail is the only supported value for Config.LogType. It asks Lambda
+// to return the last 4KB of the invocation's execution log.
+const LogTypeTail = "Tail"
+
+// Config describes how to proxy requests under a single path to AWS Lambda.
+type Config struct {
+	Path string
+
+	AwsAccess string
+	AwsSecret string
+	AwsRegion string
+
+	// AwsRoleArn, when set, causes the handler to assume this role via STS
+	// rather than using AwsAccess/AwsSecret or the default credential chain.
+	AwsRoleArn         string
+	AwsRoleSessionName string
+	AwsExternalID      string
+
+	// AwsProfile selects a named profile from the shared AWS credentials
+	// file instead of static or assumed-role credentials.
+	AwsProfile string
+
+	// PayloadFormat selects the shape of the request/response JSON exchanged
+	// with Lambda. One of PayloadFormatNative (the default),
+	// PayloadFormatAPIGateway, or PayloadFormatAPIGatewayV2.
+	PayloadFormat string
+
+	// InvocationType is one of InvocationTypeRequestResponse (the default),
+	// InvocationTypeEvent, or InvocationTypeDryRun.
+	InvocationType string
+
+	// AsyncStatus is the HTTP status code written for an InvocationTypeEvent
+	// invocation. Defaults to http.StatusAccepted.
+	AsyncStatus int
+
+	// LogType, when set to LogTypeTail, asks Lambda to include the last 4KB
+	// of the invocation's execution log in the response, which is then
+	// written to Caddy's error log.
+	LogType string
+
+	// CloudWatchNamespace, when set, enables publishing per-invocation
+	// CloudWatch metrics (invocation count, error count, throttle count,
+	// latency) to this namespace.
+	CloudWatchNamespace string
+
+	// CloudWatchDimensions are additional dimensions attached to every
+	// published metric, alongside a FunctionName dimension added
+	// automatically.
+	CloudWatchDimensions map[string]string
+
+	// CloudWatchFlushInterval controls how often batched metrics are
+	// flushed to CloudWatch. Defaults to one minute.
+	CloudWatchFlushInterval time.Duration
+
+	// CloudWatchRegion overrides AwsRegion for the CloudWatch client, if
+	// set.
+	CloudWatchRegion string
+
+	// LogInvocationsFormat selects the structured invocation log format.
+	// The only supported value is LogInvocationsJSON.
+	LogInvocationsFormat string
+
+	// InvocationLogWriter is where structured invocation log lines are
+	// written when LogInvocationsFormat is set.
+	InvocationLogWriter io.Writer
+
+	// BinaryMediaTypes lists the content types (each optionally containing a
+	// single leading and/or trailing '*' wildcard, e.g. "image/*") that
+	// should be treated as binary: request bodies matching one of these are
+	// base64-encoded before being sent to Lambda, and reply bodies whose
+	// content type matches are base64-decoded before being written back.
+	BinaryMediaTypes []string
+
+	metrics *metricsPublisher
+
+	Qualifier string
+
+	Include []string
+	Exclude []string
+
+	NamePrepend string
+	NameAppend  string
+
+	invoker Invoker
+}
+
+// ParseConfigs parses one or more awslambda directive blocks out of c.
+func ParseConfigs(c *caddy.Controller) ([]*Config, error) {
+	var configs []*Config
+
+	for c.Next() {
+		conf := &Config{
+			Include: []string{},
+			Exclude: []string{},
+		}
+
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		conf.Path = args[0]
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "aws_access":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.AwsAccess = c.Val()
+			case "aws_secret":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.AwsSecret = c.Val()
+			case "aws_region":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.AwsRegion = c.Val()
+			case "aws_role_arn":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.AwsRoleArn = c.Val()
+			case "aws_role_session_name":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.AwsRoleSessionName = c.Val()
+			case "aws_external_id":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.AwsExternalID = c.Val()
+			case "aws_profile":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.AwsProfile = c.Val()
+			case "payload_format":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case PayloadFormatNative, PayloadFormatAPIGateway, PayloadFormatAPIGatewayV2:
+					conf.PayloadFormat = c.Val()
+				default:
+					return nil, c.ArgErr()
+				}
+			case "invocation_type":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case InvocationTypeRequestResponse, InvocationTypeEvent, InvocationTypeDryRun:
+					conf.InvocationType = c.Val()
+				default:
+					return nil, c.ArgErr()
+				}
+			case "async_status":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				status, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, c.ArgErr()
+				}
+				conf.AsyncStatus = status
+			case "log_type":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if c.Val() != LogTypeTail {
+					return nil, c.ArgErr()
+				}
+				conf.LogType = c.Val()
+			case "cloudwatch_namespace":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.CloudWatchNamespace = c.Val()
+			case "cloudwatch_dimensions":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				conf.CloudWatchDimensions = make(map[string]string, len(args))
+				for _, kv := range args {
+					k, v, ok := splitDimension(kv)
+					if !ok {
+						return nil, c.ArgErr()
+					}
+					conf.CloudWatchDimensions[k] = v
+				}
+			case "cloudwatch_flush_interval":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				interval, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return nil, c.ArgErr()
+				}
+				conf.CloudWatchFlushInterval = interval
+			case "cloudwatch_region":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.CloudWatchRegion = c.Val()
+			case "log_invocations":
+				args := c.RemainingArgs()
+				if len(args) == 0 || args[0] != LogInvocationsJSON {
+					return nil, c.ArgErr()
+				}
+				conf.LogInvocationsFormat = args[0]
+				sink := "stdout"
+				if len(args) > 1 {
+					sink = args[1]
+				}
+				w, err := openLogSink(sink)
+				if err != nil {
+					return nil, err
+				}
+				conf.InvocationLogWriter = w
+				if f, ok := w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+					c.OnShutdown(func() error {
+						return f.Close()
+					})
+				}
+			case "binary_media_types":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				conf.BinaryMediaTypes = args
+			case "qualifier":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.Qualifier = c.Val()
+			case "include":
+				conf.Include = c.RemainingArgs()
+			case "exclude":
+				conf.Exclude = c.RemainingArgs()
+			case "name_prepend":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.NamePrepend = c.Val()
+			case "name_append":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				conf.NameAppend = c.Val()
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+
+		sess := session.Must(session.NewSession(conf.ToAwsConfig()))
+		conf.invoker = lambdaInvoker{svc: lambda.New(sess)}
+
+		if conf.CloudWatchNamespace != "" {
+			cwConf := conf.ToAwsConfig()
+			if conf.CloudWatchRegion != "" {
+				cwConf.Region = aws.String(conf.CloudWatchRegion)
+			}
+			cwSess := session.Must(session.NewSession(cwConf))
+			conf.metrics = newMetricsPublisher(conf.CloudWatchNamespace, conf.CloudWatchDimensions,
+				conf.CloudWatchFlushInterval, cloudwatch.New(cwSess))
+			c.OnShutdown(func() error {
+				conf.metrics.Close()
+				return nil
+			})
+		}
+
+		configs = append(configs, conf)
+	}
+
+	return configs, nil
+}
+
+// splitDimension splits a "name:value" CloudWatch dimension argument.
+func splitDimension(s string) (name, value string, ok bool) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return "", "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// openLogSink opens the destination for a log_invocations directive: the
+// literal values "stdout"/"stderr", or a file path opened for appending.
+func openLogSink(dest string) (io.Writer, error) {
+	switch dest {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		return os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+}
+
+// ToAwsConfig builds the aws.Config that should be used to reach Lambda for
+// this Config, picking the most specific credential source that was
+// configured: an assumed role, a shared-credentials profile, static keys, or
+// (failing all of those) the default SDK credential chain.
+func (c *Config) ToAwsConfig() *aws.Config {
+	conf := aws.NewConfig()
+	if c.AwsRegion != "" {
+		conf.Region = aws.String(c.AwsRegion)
+	}
+
+	switch {
+	case c.AwsRoleArn != "":
+		baseSess := session.Must(session.NewSession(aws.NewConfig().WithRegion(c.AwsRegion)))
+		stsClient := sts.New(baseSess)
+		conf.Credentials = stscreds.NewCredentialsWithClient(stsClient, c.AwsRoleArn, func(p *stscreds.AssumeRoleProvider) {
+			if c.AwsRoleSessionName != "" {
+				p.RoleSessionName = c.AwsRoleSessionName
+			}
+			if c.AwsExternalID != "" {
+				p.ExternalID = aws.String(c.AwsExternalID)
+			}
+		})
+	case c.AwsProfile != "":
+		conf.Credentials = credentials.NewSharedCredentials("", c.AwsProfile)
+	case c.AwsAccess != "" && c.AwsSecret != "":
+		conf.Credentials = credentials.NewStaticCredentials(c.AwsAccess, c.AwsSecret, "")
+	}
+
+	return conf
+}
+
+// AcceptsFunction reports whether name is allowed to be invoked by this
+// Config, according to its Include/Exclude glob rules. Exclude always wins
+// over Include.
+func (c *Config) AcceptsFunction(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, rule := range c.Exclude {
+		if matchGlob(name, rule) {
+			return false
+		}
+	}
+
+	if len(c.Include) == 0 {
+		return true
+	}
+
+	for _, rule := range c.Include {
+		if matchGlob(name, rule) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchGlob reports whether candidate matches rule, where rule may contain a
+// single leading and/or trailing '*' wildcard.
+func matchGlob(candidate, rule string) bool {
+	if rule == candidate {
+		return true
+	}
+
+	prefix := strings.HasPrefix(rule, "*")
+	suffix := strings.HasSuffix(rule, "*")
+	trimmed := strings.Trim(rule, "*")
+
+	switch {
+	case prefix && suffix:
+		return strings.Contains(candidate, trimmed)
+	case prefix:
+		return strings.HasSuffix(candidate, trimmed)
+	case suffix:
+		return strings.HasPrefix(candidate, trimmed)
+	default:
+		return false
+	}
+}
+
+// matchesBinaryType reports whether contentType matches any of patterns,
+// using the same glob rules as AcceptsFunction's Include/Exclude lists.
+func matchesBinaryType(contentType string, patterns []string) bool {
+	if contentType == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if matchGlob(contentType, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaybeToInvokeInput converts r into a lambda.InvokeInput for this Config, or
+// returns a nil input (with no error) if r's target function is not accepted
+// by c's Include/Exclude rules.
+func (c *Config) MaybeToInvokeInput(r *http.Request) (*lambda.InvokeInput, error) {
+	name := path.Base(r.URL.Path)
+	if !c.AcceptsFunction(name) {
+		return nil, nil
+	}
+
+	funcName := c.NamePrepend + name + c.NameAppend
+
+	payload, err := c.buildPayload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &lambda.InvokeInput{
+		FunctionName: &funcName,
+		Payload:      payload,
+	}
+	if c.Qualifier != "" {
+		input.Qualifier = &c.Qualifier
+	}
+	if c.InvocationType != "" {
+		input.InvocationType = &c.InvocationType
+	}
+	if c.LogType != "" && (c.InvocationType == "" || c.InvocationType == InvocationTypeRequestResponse) {
+		input.LogType = &c.LogType
+	}
+
+	return input, nil
+}
+
+// buildPayload marshals r into the wire format selected by c.PayloadFormat.
+func (c *Config) buildPayload(r *http.Request) ([]byte, error) {
+	switch c.PayloadFormat {
+	case PayloadFormatAPIGateway:
+		req, err := NewAPIGatewayRequest(r, c.BinaryMediaTypes)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(req), nil
+	case PayloadFormatAPIGatewayV2:
+		req, err := NewAPIGatewayV2Request(r, c.BinaryMediaTypes)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(req), nil
+	default:
+		req, err := NewRequest(r, c.BinaryMediaTypes)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(req), nil
+	}
+}
+
+// Request is the JSON payload sent to the Lambda function.
+type Request struct {
+	Method          string      `json:"method"`
+	Path            string      `json:"path"`
+	Query           url.Values  `json:"query"`
+	Headers         http.Header `json:"headers"`
+	Body            string      `json:"body"`
+	IsBase64Encoded bool        `json:"isBase64Encoded"`
+}
+
+// NewRequest builds the Request payload that will be sent to Lambda for r.
+// If r's Content-Type matches one of binaryMediaTypes, the body is
+// base64-encoded and IsBase64Encoded is set.
+func NewRequest(r *http.Request, binaryMediaTypes []string) (*Request, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &Request{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+	}
+
+	if matchesBinaryType(r.Header.Get("Content-Type"), binaryMediaTypes) {
+		req.Body = base64.StdEncoding.EncodeToString(body)
+		req.IsBase64Encoded = true
+	} else {
+		req.Body = string(body)
+	}
+
+	return req, nil
+}
+
+// marshalJSON marshals v to JSON, returning nil on error since v is always
+// one of our own types and is never expected to fail to marshal.
+func marshalJSON(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// ReplyMeta carries the HTTP-facing parts of a Reply.
+type ReplyMeta struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+}
+
+// Reply is the JSON payload a Lambda function is expected to return.
+type Reply struct {
+	Meta ReplyMeta `json:"meta"`
+	Body string    `json:"body"`
+
+	// BodyEncoding, when set to "base64", indicates that Body is
+	// base64-encoded and should be decoded before being written to the
+	// client.
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+}
+
+// ParseReply unmarshals a Lambda invocation's raw payload into a Reply,
+// interpreting it according to format (one of the PayloadFormat* constants;
+// the empty string behaves like PayloadFormatNative). binaryMediaTypes is
+// consulted to decide whether to base64-decode the body when the payload
+// itself doesn't say so explicitly.
+func ParseReply(payload []byte, format string, binaryMediaTypes []string) (*Reply, error) {
+	switch format {
+	case PayloadFormatAPIGateway:
+		return parseAPIGatewayReply(payload, binaryMediaTypes)
+	case PayloadFormatAPIGatewayV2:
+		return parseAPIGatewayV2Reply(payload, binaryMediaTypes)
+	default:
+		return parseNativeReply(payload, binaryMediaTypes)
+	}
+}
+
+func parseNativeReply(payload []byte, binaryMediaTypes []string) (*Reply, error) {
+	reply := new(Reply)
+	if len(payload) == 0 {
+		return reply, nil
+	}
+	if err := json.Unmarshal(payload, reply); err != nil {
+		return nil, err
+	}
+
+	encoded := reply.BodyEncoding == "base64" || matchesBinaryType(reply.Meta.Headers.Get("Content-Type"), binaryMediaTypes)
+	body, err := decodeBody(reply.Body, encoded)
+	if err != nil {
+		return nil, err
+	}
+	reply.Body = body
+
+	return reply, nil
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -90,6 +92,48 @@ func TestToAwsConfigStaticRegion(t *testing.T) {
 	}
 }
 
+func TestToAwsConfigSharedProfile(t *testing.T) {
+	c := &Config{
+		AwsProfile: "my-profile",
+	}
+	expected := credentials.NewSharedCredentials("", "my-profile")
+	actual := c.ToAwsConfig()
+	if !reflect.DeepEqual(expected, actual.Credentials) {
+		t.Errorf("\nExpected: %v\n  Actual: %v", expected, actual.Credentials)
+	}
+}
+
+func TestToAwsConfigAssumeRole(t *testing.T) {
+	c := &Config{
+		AwsRoleArn:         "arn:aws:iam::123456789012:role/my-role",
+		AwsRoleSessionName: "my-session",
+		AwsExternalID:      "my-external-id",
+	}
+	actual := c.ToAwsConfig()
+	if actual.Credentials == nil {
+		t.Fatal("Expected non-nil Credentials for an assumed role")
+	}
+	if reflect.DeepEqual(aws.NewConfig().Credentials, actual.Credentials) {
+		t.Errorf("Expected assume-role Credentials to differ from the default chain")
+	}
+}
+
+func TestToAwsConfigAssumeRolePrecedesOtherCreds(t *testing.T) {
+	c := &Config{
+		AwsRoleArn: "arn:aws:iam::123456789012:role/my-role",
+		AwsProfile: "my-profile",
+		AwsAccess:  "a-key",
+		AwsSecret:  "secret",
+	}
+	actual := c.ToAwsConfig()
+	if reflect.DeepEqual(credentials.NewSharedCredentials("", "my-profile"), actual.Credentials) {
+		t.Errorf("Expected AwsRoleArn to take precedence over AwsProfile")
+	}
+	if reflect.DeepEqual(credentials.NewStaticCredentials("a-key", "secret", ""), actual.Credentials) {
+		t.Errorf("Expected AwsRoleArn to take precedence over static credentials")
+	}
+}
+
 func TestToAwsConfigDefaults(t *testing.T) {
 	c := &Config{}
 	expected := aws.NewConfig()
@@ -118,18 +162,97 @@ func TestParseConfigs(t *testing.T) {
     exclude    *blah*
     name_prepend   apex-foo_
     name_append    _suffix_here
+    payload_format apigateway
+}`,
+			[]*Config{
+				&Config{
+					Path:          "/blah/",
+					AwsAccess:     "my-access",
+					AwsSecret:     "my-secret",
+					AwsRegion:     "us-west-1",
+					Qualifier:     "prod",
+					Include:       []string{"foo*", "some-other"},
+					Exclude:       []string{"*blah*"},
+					NamePrepend:   "apex-foo_",
+					NameAppend:    "_suffix_here",
+					PayloadFormat: "apigateway",
+				},
+			},
+		},
+		{`awslambda /async/ {
+    invocation_type Event
+    async_status    200
+    log_type        Tail
+}`,
+			[]*Config{
+				&Config{
+					Path:           "/async/",
+					InvocationType: "Event",
+					AsyncStatus:    200,
+					LogType:        "Tail",
+					Include:        []string{},
+					Exclude:        []string{},
+				},
+			},
+		},
+		{`awslambda /observed/ {
+    cloudwatch_namespace       MyApp
+    cloudwatch_dimensions      Env:prod Team:backend
+    cloudwatch_flush_interval  1h
+    cloudwatch_region          us-west-2
+    log_invocations            json stdout
+}`,
+			[]*Config{
+				&Config{
+					Path:                    "/observed/",
+					CloudWatchNamespace:     "MyApp",
+					CloudWatchDimensions:    map[string]string{"Env": "prod", "Team": "backend"},
+					CloudWatchFlushInterval: time.Hour,
+					CloudWatchRegion:        "us-west-2",
+					LogInvocationsFormat:    "json",
+					InvocationLogWriter:     os.Stdout,
+					Include:                 []string{},
+					Exclude:                 []string{},
+				},
+			},
+		},
+		{`awslambda /assumed-role/ {
+    aws_role_arn            arn:aws:iam::123456789012:role/my-role
+    aws_role_session_name   my-session
+    aws_external_id         my-external-id
+}`,
+			[]*Config{
+				&Config{
+					Path:               "/assumed-role/",
+					AwsRoleArn:         "arn:aws:iam::123456789012:role/my-role",
+					AwsRoleSessionName: "my-session",
+					AwsExternalID:      "my-external-id",
+					Include:            []string{},
+					Exclude:            []string{},
+				},
+			},
+		},
+		{`awslambda /shared-profile/ {
+    aws_profile my-profile
 }`,
 			[]*Config{
 				&Config{
-					Path:        "/blah/",
-					AwsAccess:   "my-access",
-					AwsSecret:   "my-secret",
-					AwsRegion:   "us-west-1",
-					Qualifier:   "prod",
-					Include:     []string{"foo*", "some-other"},
-					Exclude:     []string{"*blah*"},
-					NamePrepend: "apex-foo_",
-					NameAppend:  "_suffix_here",
+					Path:       "/shared-profile/",
+					AwsProfile: "my-profile",
+					Include:    []string{},
+					Exclude:    []string{},
+				},
+			},
+		},
+		{`awslambda /binary/ {
+    binary_media_types image/* application/octet-stream
+}`,
+			[]*Config{
+				&Config{
+					Path:             "/binary/",
+					BinaryMediaTypes: []string{"image/*", "application/octet-stream"},
+					Include:          []string{},
+					Exclude:          []string{},
 				},
 			},
 		},
@@ -166,6 +289,7 @@ awslambda /second/path/ {
 		}
 		for i := range actual {
 			actual[i].invoker = nil
+			actual[i].metrics = nil
 		}
 		eqOrErr(test.expected, actual, i, t)
 	}
@@ -189,7 +313,7 @@ func TestMaybeToInvokeInput(t *testing.T) {
 		t.Fatalf("MaybeToInvokeInput returned nil input")
 	}
 	funcName := "before-user-after"
-	req, err := NewRequest(r2)
+	req, err := NewRequest(r2, nil)
 	if err != nil {
 		t.Fatalf("NewRequest returned err: %v", err)
 	}
@@ -208,6 +332,82 @@ func TestMaybeToInvokeInput(t *testing.T) {
 	}
 }
 
+func TestMaybeToInvokeInputInvocationTypeAndLogType(t *testing.T) {
+	r := mustNewRequest("GET", "/api/user", bytes.NewBufferString(""))
+
+	c := Config{
+		InvocationType: InvocationTypeEvent,
+		LogType:        LogTypeTail,
+	}
+	input, err := c.MaybeToInvokeInput(r)
+	if err != nil {
+		t.Fatalf("MaybeToInvokeInput returned err: %v", err)
+	}
+	if input.InvocationType == nil || *input.InvocationType != InvocationTypeEvent {
+		t.Errorf("Expected InvocationType %s, got %v", InvocationTypeEvent, input.InvocationType)
+	}
+	// LogType only applies to RequestResponse invocations
+	if input.LogType != nil {
+		t.Errorf("Expected nil LogType for an Event invocation, got %v", *input.LogType)
+	}
+
+	c = Config{LogType: LogTypeTail}
+	input, err = c.MaybeToInvokeInput(r)
+	if err != nil {
+		t.Fatalf("MaybeToInvokeInput returned err: %v", err)
+	}
+	if input.LogType == nil || *input.LogType != LogTypeTail {
+		t.Errorf("Expected LogType %s, got %v", LogTypeTail, input.LogType)
+	}
+}
+
+func TestMatchesBinaryType(t *testing.T) {
+	for i, test := range []struct {
+		contentType string
+		patterns    []string
+		expected    bool
+	}{
+		{"", []string{"*"}, false},
+		{"image/png", []string{"image/*"}, true},
+		{"image/png", []string{"application/octet-stream"}, false},
+		{"application/octet-stream", []string{"application/octet-stream"}, true},
+		{"text/plain", nil, false},
+	} {
+		actual := matchesBinaryType(test.contentType, test.patterns)
+		if actual != test.expected {
+			t.Errorf("\nTest %d - contentType: %s  patterns: %v\nExpected: %v\n  Actual: %v",
+				i, test.contentType, test.patterns, test.expected, actual)
+		}
+	}
+}
+
+func TestNewRequestBinaryEncoding(t *testing.T) {
+	r := mustNewRequest("POST", "/upload", bytes.NewBufferString("\x89PNG"))
+	r.Header.Set("Content-Type", "image/png")
+
+	req, err := NewRequest(r, []string{"image/*"})
+	if err != nil {
+		t.Fatalf("NewRequest returned err: %v", err)
+	}
+	if !req.IsBase64Encoded {
+		t.Fatalf("Expected IsBase64Encoded to be true")
+	}
+	if req.Body != "iVBORw==" {
+		t.Errorf("Expected base64 body iVBORw==, got %s", req.Body)
+	}
+}
+
+func TestParseNativeReplyBinaryContentType(t *testing.T) {
+	payload := []byte(`{"meta":{"status":200,"headers":{"Content-Type":["image/png"]}},"body":"aGVsbG8="}`)
+	reply, err := ParseReply(payload, PayloadFormatNative, []string{"image/*"})
+	if err != nil {
+		t.Fatalf("ParseReply returned err: %v", err)
+	}
+	if reply.Body != "hello" {
+		t.Errorf("Expected decoded body hello, got %s", reply.Body)
+	}
+}
+
 func mustNewRequest(method, path string, body io.Reader) *http.Request {
 	req, err := http.NewRequest(method, path, body)
 	if err != nil {
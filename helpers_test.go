@@ -0,0 +1,14 @@
+package awslambda
+
+import (
+	"reflect"
+	"testing"
+)
+
+// eqOrErr fails the test with a consistent message if expected and actual
+// are not deeply equal.
+func eqOrErr(expected, actual interface{}, i int, t *testing.T) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nTest %d\nExpected: %#v\n  Actual: %#v", i, expected, actual)
+	}
+}
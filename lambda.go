@@ -1,15 +1,34 @@
 package awslambda
 
 import (
+	"encoding/base64"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
-// Invoker calls a single AWS Lambda function - can be mocked for tests
+// Invoker calls a single AWS Lambda function - can be mocked for tests. The
+// returned requestID is the AWS request ID of the call, or "" if it could
+// not be determined (e.g. the request never reached Lambda).
 type Invoker interface {
-	Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, error)
+	Invoke(input *lambda.InvokeInput) (out *lambda.InvokeOutput, requestID string, err error)
+}
+
+// lambdaInvoker adapts the AWS SDK's *lambda.Lambda client to Invoker,
+// capturing the request ID of each call via the SDK's lower-level
+// *request.Request.
+type lambdaInvoker struct {
+	svc *lambda.Lambda
+}
+
+func (i lambdaInvoker) Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, string, error) {
+	req, out := i.svc.InvokeRequest(input)
+	err := req.Send()
+	return out, req.RequestID, err
 }
 
 // Handler represents a middleware instance that can gateway requests to AWS Lambda
@@ -22,7 +41,6 @@ type Handler struct {
 // the request to AWS Lambda via the Invoke function
 //
 // See: http://docs.aws.amazon.com/lambda/latest/dg/API_Invoke.html
-//
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	conf, invokeInput, err := h.match(r)
 	if err != nil {
@@ -33,14 +51,58 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 	}
 
 	// Invoke function at AWS
-	invokeOut, err := conf.invoker.Invoke(invokeInput)
+	start := time.Now()
+	invokeOut, requestID, err := conf.invoker.Invoke(invokeInput)
 	if err != nil {
+		status := 0
+		if conf.InvocationType == InvocationTypeDryRun {
+			status = http.StatusBadRequest
+		}
+		conf.recordInvocation(*invokeInput.FunctionName, "", status, time.Since(start), requestID, err)
+		if status != 0 {
+			return status, nil
+		}
 		return 0, err
 	}
 
+	executedVersion := ""
+	if invokeOut.ExecutedVersion != nil {
+		executedVersion = *invokeOut.ExecutedVersion
+	}
+
+	if conf.LogType == LogTypeTail && invokeOut.LogResult != nil {
+		logBytes, decodeErr := base64.StdEncoding.DecodeString(*invokeOut.LogResult)
+		if decodeErr == nil {
+			log.Printf("[INFO] awslambda: execution log for %s\n%s", *invokeInput.FunctionName, logBytes)
+		}
+	}
+
+	switch conf.InvocationType {
+	case InvocationTypeEvent:
+		status := conf.AsyncStatus
+		if status <= 0 {
+			status = http.StatusAccepted
+		}
+		if requestID != "" {
+			w.Header().Set("X-Amzn-RequestId", requestID)
+		}
+		conf.recordInvocation(*invokeInput.FunctionName, executedVersion, status, time.Since(start), requestID, nil)
+		w.WriteHeader(status)
+		return status, nil
+	case InvocationTypeDryRun:
+		status := http.StatusNoContent
+		if invokeOut.StatusCode != nil && *invokeOut.StatusCode > 0 {
+			status = int(*invokeOut.StatusCode)
+		}
+		conf.recordInvocation(*invokeInput.FunctionName, executedVersion, status, time.Since(start), requestID, nil)
+		w.WriteHeader(status)
+		return status, nil
+	}
+
 	// Unpack the reply JSON
-	reply, err := ParseReply(invokeOut.Payload)
+	reply, err := ParseReply(invokeOut.Payload, conf.PayloadFormat, conf.BinaryMediaTypes)
 	if err != nil {
+		conf.recordInvocation(*invokeInput.FunctionName, executedVersion, 0, time.Since(start), requestID, err)
 		return 0, err
 	}
 
@@ -59,6 +121,7 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		reply.Meta.Status = http.StatusOK
 	}
 
+	w.Header().Set("Content-Length", strconv.Itoa(len(reply.Body)))
 	w.WriteHeader(reply.Meta.Status)
 
 	// Write the response body
@@ -67,6 +130,8 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		return 0, err
 	}
 
+	conf.recordInvocation(*invokeInput.FunctionName, executedVersion, reply.Meta.Status, time.Since(start), requestID, nil)
+
 	return reply.Meta.Status, nil
 }
 
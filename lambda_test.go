@@ -0,0 +1,183 @@
+package awslambda
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// mockInvoker is an Invoker that returns a canned output/requestID/err
+// without making any AWS calls.
+type mockInvoker struct {
+	out       *lambda.InvokeOutput
+	requestID string
+	err       error
+}
+
+func (m *mockInvoker) Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, string, error) {
+	return m.out, m.requestID, m.err
+}
+
+// nopHandler is an httpserver.Handler that should never be reached, since
+// every test Config below matches every request it's given.
+type nopHandler struct{}
+
+func (nopHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	return 0, errors.New("nopHandler: unexpectedly reached Next")
+}
+
+func TestServeHTTPEventInvocation(t *testing.T) {
+	for i, test := range []struct {
+		asyncStatus    int
+		requestID      string
+		expectedStatus int
+	}{
+		{0, "req-1", http.StatusAccepted},
+		{http.StatusCreated, "", http.StatusCreated},
+	} {
+		conf := &Config{
+			Path:           "/lambda/",
+			InvocationType: InvocationTypeEvent,
+			AsyncStatus:    test.asyncStatus,
+			invoker: &mockInvoker{
+				out:       &lambda.InvokeOutput{},
+				requestID: test.requestID,
+			},
+		}
+		h := Handler{Next: nopHandler{}, Configs: []*Config{conf}}
+		w := httptest.NewRecorder()
+
+		status, err := h.ServeHTTP(w, mustNewRequest("POST", "/lambda/my-func", bytes.NewBufferString("")))
+		if err != nil {
+			t.Fatalf("Test %d: ServeHTTP returned err: %v", i, err)
+		}
+		eqOrErr(test.expectedStatus, status, i, t)
+		eqOrErr(test.expectedStatus, w.Code, i, t)
+		eqOrErr(test.requestID, w.Header().Get("X-Amzn-RequestId"), i, t)
+	}
+}
+
+func TestServeHTTPDryRunInvocation(t *testing.T) {
+	for i, test := range []struct {
+		invokeErr      error
+		outStatusCode  *int64
+		expectedStatus int
+	}{
+		{nil, nil, http.StatusNoContent},
+		{nil, aws.Int64(422), 422},
+		{errors.New("ValidationException: bad input"), nil, http.StatusBadRequest},
+	} {
+		conf := &Config{
+			Path:           "/lambda/",
+			InvocationType: InvocationTypeDryRun,
+			invoker: &mockInvoker{
+				out: &lambda.InvokeOutput{StatusCode: test.outStatusCode},
+				err: test.invokeErr,
+			},
+		}
+		h := Handler{Next: nopHandler{}, Configs: []*Config{conf}}
+		w := httptest.NewRecorder()
+
+		status, err := h.ServeHTTP(w, mustNewRequest("POST", "/lambda/my-func", bytes.NewBufferString("")))
+		if err != nil {
+			t.Fatalf("Test %d: ServeHTTP returned err: %v", i, err)
+		}
+		eqOrErr(test.expectedStatus, status, i, t)
+		// A successful DryRun writes its status directly; an invoke error
+		// leaves that to Caddy's error handling, so only the returned status
+		// is meaningful there.
+		if test.invokeErr == nil {
+			eqOrErr(test.expectedStatus, w.Code, i, t)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("\nTest %d\nExpected no body written, got %q", i, w.Body.String())
+		}
+	}
+}
+
+func TestServeHTTPInvokeError(t *testing.T) {
+	invokeErr := errors.New("boom")
+	conf := &Config{
+		Path:    "/lambda/",
+		invoker: &mockInvoker{err: invokeErr},
+	}
+	h := Handler{Next: nopHandler{}, Configs: []*Config{conf}}
+	w := httptest.NewRecorder()
+
+	status, err := h.ServeHTTP(w, mustNewRequest("POST", "/lambda/my-func", bytes.NewBufferString("")))
+	if err != invokeErr {
+		t.Errorf("Expected error to be propagated, got %v", err)
+	}
+	if status != 0 {
+		t.Errorf("Expected status 0, got %d", status)
+	}
+}
+
+func TestServeHTTPRecordsInvocationLog(t *testing.T) {
+	var buf bytes.Buffer
+	conf := &Config{
+		Path:                 "/lambda/",
+		Qualifier:            "prod",
+		LogInvocationsFormat: LogInvocationsJSON,
+		InvocationLogWriter:  &buf,
+		invoker: &mockInvoker{
+			out:       &lambda.InvokeOutput{Payload: []byte(`{"meta":{"status":200},"body":"hi"}`)},
+			requestID: "req-abc",
+		},
+	}
+	h := Handler{Next: nopHandler{}, Configs: []*Config{conf}}
+	w := httptest.NewRecorder()
+
+	status, err := h.ServeHTTP(w, mustNewRequest("GET", "/lambda/my-func", bytes.NewBufferString("")))
+	if err != nil {
+		t.Fatalf("ServeHTTP returned err: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	var entry invocationLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Unmarshal returned err: %v", err)
+	}
+	if entry.FunctionName != "my-func" || entry.Qualifier != "prod" || entry.Status != http.StatusOK {
+		t.Errorf("Unexpected log entry: %#v", entry)
+	}
+	if entry.RequestID != "req-abc" {
+		t.Errorf("Expected RequestID req-abc, got %s", entry.RequestID)
+	}
+}
+
+func TestServeHTTPWritesDecodedBinaryBody(t *testing.T) {
+	conf := &Config{
+		Path:             "/lambda/",
+		BinaryMediaTypes: []string{"image/*"},
+		invoker: &mockInvoker{
+			out: &lambda.InvokeOutput{
+				Payload: []byte(`{"meta":{"status":200,"headers":{"Content-Type":["image/png"]}},"body":"aGVsbG8="}`),
+			},
+		},
+	}
+	h := Handler{Next: nopHandler{}, Configs: []*Config{conf}}
+	w := httptest.NewRecorder()
+
+	status, err := h.ServeHTTP(w, mustNewRequest("GET", "/lambda/my-func", bytes.NewBufferString("")))
+	if err != nil {
+		t.Fatalf("ServeHTTP returned err: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if w.Body.String() != "hello" {
+		t.Errorf("Expected decoded body hello, got %q", w.Body.String())
+	}
+	if got := w.Header().Get("Content-Length"); got != "5" {
+		t.Errorf("Expected Content-Length 5, got %s", got)
+	}
+}
@@ -0,0 +1,193 @@
+package awslambda
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// LogInvocationsJSON is the only supported value for
+// Config.LogInvocationsFormat.
+const LogInvocationsJSON = "json"
+
+// Metric names published under a Config's CloudWatchNamespace.
+const (
+	metricNameInvocations = "Invocations"
+	metricNameErrors      = "Errors"
+	metricNameThrottles   = "Throttles"
+	metricNameDuration    = "Duration"
+)
+
+// isThrottleError reports whether err is one of the AWS error codes Lambda
+// returns when a function is being throttled.
+func isThrottleError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch awsErr.Code() {
+	case "TooManyRequestsException", "ServiceException":
+		return true
+	default:
+		return false
+	}
+}
+
+// metricsPublisher batches per-invocation CloudWatch metrics and flushes
+// them to CloudWatch on a background goroutine.
+type metricsPublisher struct {
+	namespace  string
+	dimensions []*cloudwatch.Dimension
+	client     *cloudwatch.CloudWatch
+
+	mu   sync.Mutex
+	data []*cloudwatch.MetricDatum
+
+	stop chan struct{}
+}
+
+// newMetricsPublisher starts a metricsPublisher that flushes to client every
+// interval (or once a minute, if interval is zero or negative). Callers must
+// call Close when the publisher is no longer needed, to stop its background
+// goroutine.
+func newMetricsPublisher(namespace string, dimensions map[string]string, interval time.Duration, client *cloudwatch.CloudWatch) *metricsPublisher {
+	dims := make([]*cloudwatch.Dimension, 0, len(dimensions))
+	for k, v := range dimensions {
+		dims = append(dims, &cloudwatch.Dimension{Name: aws.String(k), Value: aws.String(v)})
+	}
+
+	p := &metricsPublisher{
+		namespace:  namespace,
+		dimensions: dims,
+		client:     client,
+		stop:       make(chan struct{}),
+	}
+
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go p.run(interval)
+
+	return p
+}
+
+func (p *metricsPublisher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.flush()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Close stops the publisher's background flush goroutine, flushing any
+// buffered metrics first.
+func (p *metricsPublisher) Close() {
+	close(p.stop)
+	p.flush()
+}
+
+// record buffers the metrics for a single invocation of functionName, to be
+// sent on the next flush.
+func (p *metricsPublisher) record(functionName, executedVersion string, duration time.Duration, invokeErr error) {
+	dims := make([]*cloudwatch.Dimension, len(p.dimensions), len(p.dimensions)+2)
+	copy(dims, p.dimensions)
+	dims = append(dims, &cloudwatch.Dimension{Name: aws.String("FunctionName"), Value: aws.String(functionName)})
+	if executedVersion != "" {
+		dims = append(dims, &cloudwatch.Dimension{Name: aws.String("ExecutedVersion"), Value: aws.String(executedVersion)})
+	}
+
+	datum := func(name string, value float64, unit string) *cloudwatch.MetricDatum {
+		return &cloudwatch.MetricDatum{
+			MetricName: aws.String(name),
+			Value:      aws.Float64(value),
+			Unit:       aws.String(unit),
+			Dimensions: dims,
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.data = append(p.data, datum(metricNameInvocations, 1, cloudwatch.StandardUnitCount))
+	p.data = append(p.data, datum(metricNameDuration, float64(duration.Milliseconds()), cloudwatch.StandardUnitMilliseconds))
+	if invokeErr != nil {
+		p.data = append(p.data, datum(metricNameErrors, 1, cloudwatch.StandardUnitCount))
+		if isThrottleError(invokeErr) {
+			p.data = append(p.data, datum(metricNameThrottles, 1, cloudwatch.StandardUnitCount))
+		}
+	}
+}
+
+// flush publishes any buffered metrics to CloudWatch.
+func (p *metricsPublisher) flush() {
+	p.mu.Lock()
+	data := p.data
+	p.data = nil
+	p.mu.Unlock()
+
+	if len(data) == 0 {
+		return
+	}
+
+	_, err := p.client.PutMetricData(&cloudwatch.PutMetricDataInput{
+		Namespace:  aws.String(p.namespace),
+		MetricData: data,
+	})
+	if err != nil {
+		log.Printf("[ERROR] awslambda: failed to publish CloudWatch metrics: %v", err)
+	}
+}
+
+// invocationLogEntry is one structured log line written for a single
+// invocation when Config.LogInvocationsFormat is set.
+type invocationLogEntry struct {
+	FunctionName string `json:"functionName"`
+	Qualifier    string `json:"qualifier,omitempty"`
+	Status       int    `json:"status"`
+	DurationMS   int64  `json:"durationMs"`
+	RequestID    string `json:"requestId,omitempty"`
+}
+
+// recordInvocation updates CloudWatch metrics and writes a structured
+// invocation log line for a single Lambda invocation, according to
+// whichever of CloudWatchNamespace/LogInvocationsFormat are configured on c.
+// requestID is the AWS request ID of the call, if known.
+func (c *Config) recordInvocation(functionName, executedVersion string, status int, duration time.Duration, requestID string, invokeErr error) {
+	if c.metrics != nil {
+		c.metrics.record(functionName, executedVersion, duration, invokeErr)
+	}
+
+	if c.LogInvocationsFormat != LogInvocationsJSON || c.InvocationLogWriter == nil {
+		return
+	}
+
+	entry := invocationLogEntry{
+		FunctionName: functionName,
+		Qualifier:    c.Qualifier,
+		Status:       status,
+		DurationMS:   duration.Milliseconds(),
+		RequestID:    requestID,
+	}
+	if entry.RequestID == "" {
+		if reqErr, ok := invokeErr.(awserr.RequestFailure); ok {
+			entry.RequestID = reqErr.RequestID()
+		}
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	c.InvocationLogWriter.Write(b)
+}
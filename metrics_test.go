@@ -0,0 +1,111 @@
+package awslambda
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestIsThrottleError(t *testing.T) {
+	for i, test := range []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{awserr.New("TooManyRequestsException", "slow down", nil), true},
+		{awserr.New("ServiceException", "unavailable", nil), true},
+		{awserr.New("ResourceNotFoundException", "nope", nil), false},
+	} {
+		actual := isThrottleError(test.err)
+		if actual != test.expected {
+			t.Errorf("\nTest %d\nExpected: %v\n  Actual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestMetricsPublisherRecord(t *testing.T) {
+	p := &metricsPublisher{namespace: "Test"}
+
+	p.record("my-func", "3", 0, nil)
+	if len(p.data) != 2 {
+		t.Fatalf("Expected 2 metric datums for a successful invocation, got %d", len(p.data))
+	}
+
+	p.record("my-func", "", 0, errors.New("boom"))
+	if len(p.data) != 5 {
+		t.Fatalf("Expected 3 more metric datums for a failed invocation, got %d total", len(p.data))
+	}
+
+	p.record("my-func", "", 0, awserr.New("TooManyRequestsException", "slow down", nil))
+	if len(p.data) != 9 {
+		t.Fatalf("Expected 4 more metric datums for a throttled invocation, got %d total", len(p.data))
+	}
+}
+
+func TestNewMetricsPublisherClose(t *testing.T) {
+	p := newMetricsPublisher("Test", nil, time.Millisecond, nil)
+
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return; run's ticker goroutine may have leaked")
+	}
+}
+
+func TestConfigRecordInvocationJSON(t *testing.T) {
+	var buf bytes.Buffer
+	c := &Config{
+		Qualifier:            "prod",
+		LogInvocationsFormat: LogInvocationsJSON,
+		InvocationLogWriter:  &buf,
+	}
+
+	c.recordInvocation("my-func", "3", 200, 0, "req-123", nil)
+
+	var entry invocationLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Unmarshal returned err: %v", err)
+	}
+	if entry.FunctionName != "my-func" || entry.Qualifier != "prod" || entry.Status != 200 {
+		t.Errorf("Unexpected log entry: %#v", entry)
+	}
+	if entry.RequestID != "req-123" {
+		t.Errorf("Expected RequestID req-123, got %s", entry.RequestID)
+	}
+}
+
+func TestConfigRecordInvocationJSONFallsBackToRequestFailure(t *testing.T) {
+	var buf bytes.Buffer
+	c := &Config{
+		LogInvocationsFormat: LogInvocationsJSON,
+		InvocationLogWriter:  &buf,
+	}
+
+	reqErr := awserr.NewRequestFailure(awserr.New("ServiceException", "unavailable", nil), 500, "req-from-err")
+	c.recordInvocation("my-func", "", 0, 0, "", reqErr)
+
+	var entry invocationLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Unmarshal returned err: %v", err)
+	}
+	if entry.RequestID != "req-from-err" {
+		t.Errorf("Expected RequestID req-from-err, got %s", entry.RequestID)
+	}
+}
+
+func TestConfigRecordInvocationNoop(t *testing.T) {
+	c := &Config{}
+	// Should not panic without a configured writer or metrics publisher.
+	c.recordInvocation("my-func", "", 200, 0, "", nil)
+}